@@ -0,0 +1,322 @@
+package jsonquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+// fieldRef identifies a location within an opencdc.Record that a query
+// should read from or write to. It is produced by parseFieldRef from
+// references such as ".Payload.After", ".Payload.Before", ".Key" or
+// `.Metadata["some.key"]`, optionally followed by a JSON-pointer-style
+// subpath (e.g. ".Payload.After/user/name") that addresses a nested field
+// within a StructuredData value instead of the value as a whole.
+type fieldRef struct {
+	field   string // "Payload.After", "Payload.Before", "Key" or "Metadata"
+	metaKey string // set only when field == "Metadata"
+	subpath []string
+}
+
+// defaultFieldRef is used when no source/target is configured, preserving
+// the processor's original behavior of reading from and writing to
+// Payload.After.
+const defaultFieldRef = ".Payload.After"
+
+// parseFieldRef parses a field reference like ".Payload.After",
+// ".Payload.Before", ".Key", `.Metadata["tenant_id"]`, or any of those
+// followed by a "/"-separated subpath into an existing StructuredData value.
+func parseFieldRef(ref string) (fieldRef, error) {
+	if !strings.HasPrefix(ref, ".") {
+		return fieldRef{}, fmt.Errorf("invalid field reference %q: must start with '.'", ref)
+	}
+	rest := ref[1:]
+
+	// Metadata keys can themselves contain "/" (e.g. "conduit.source/id"), so
+	// the closing `"]` must anchor the base before any subpath separator is
+	// looked for, rather than splitting on the first "/" in the whole string.
+	if strings.HasPrefix(rest, `Metadata["`) {
+		closeIdx := strings.Index(rest, `"]`)
+		if closeIdx == -1 {
+			return fieldRef{}, fmt.Errorf("unsupported field reference %q", ref)
+		}
+		key := rest[len(`Metadata["`):closeIdx]
+		if key == "" {
+			return fieldRef{}, fmt.Errorf("invalid field reference %q: empty metadata key", ref)
+		}
+		subpath, err := parseSubpath(ref, rest[closeIdx+len(`"]`):])
+		if err != nil {
+			return fieldRef{}, err
+		}
+		return fieldRef{field: "Metadata", metaKey: key, subpath: subpath}, nil
+	}
+
+	base := rest
+	var subpath []string
+	if idx := strings.Index(rest, "/"); idx != -1 {
+		base = rest[:idx]
+		subpath = strings.Split(rest[idx+1:], "/")
+	}
+
+	switch base {
+	case "Payload.After", "Payload.Before", "Key":
+		return fieldRef{field: base, subpath: subpath}, nil
+	default:
+		return fieldRef{}, fmt.Errorf("unsupported field reference %q", ref)
+	}
+}
+
+// parseSubpath splits the "/"-separated subpath that may follow a field
+// reference's base (e.g. the "/user/name" in ".Payload.After/user/name").
+// remainder is empty when there is no subpath.
+func parseSubpath(ref, remainder string) ([]string, error) {
+	if remainder == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(remainder, "/") {
+		return nil, fmt.Errorf("unsupported field reference %q", ref)
+	}
+	return strings.Split(remainder[1:], "/"), nil
+}
+
+// extractValue reads the data addressed by ref from record and decodes it
+// into a generic interface{} suitable for querying with jq or JMESPath.
+func extractValue(record opencdc.Record, ref fieldRef) (interface{}, error) {
+	switch ref.field {
+	case "Payload.After":
+		return decodeData(record.Payload.After)
+	case "Payload.Before":
+		return decodeData(record.Payload.Before)
+	case "Key":
+		return decodeData(record.Key)
+	case "Metadata":
+		v, ok := record.Metadata[ref.metaKey]
+		if !ok {
+			return nil, fmt.Errorf("metadata key %q not present", ref.metaKey)
+		}
+		return decodeMetadataValue(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported field reference %q", ref.field)
+	}
+}
+
+// decodeData converts opencdc.Data (StructuredData or RawData) into a
+// generic interface{}, following the same conventions processRecord has
+// always used for Payload.After.
+func decodeData(d opencdc.Data) (interface{}, error) {
+	switch v := d.(type) {
+	case opencdc.StructuredData:
+		return convertStructuredData(v), nil
+	case opencdc.RawData:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		var data interface{}
+		if err := json.Unmarshal(v, &data); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return data, nil
+	case nil:
+		return nil, errors.New("no data present at field reference")
+	default:
+		return nil, fmt.Errorf("unsupported payload type: %T", d)
+	}
+}
+
+// extractValues reads the data addressed by ref from record and decodes it
+// into one generic interface{} value per JSON document found there. RawData
+// fields honor rawFormat ("json", "ndjson", or "auto") so ND-JSON/JSON-Lines
+// payloads can be expanded into multiple values; all other field kinds
+// always yield exactly one value.
+func extractValues(record opencdc.Record, ref fieldRef, rawFormat string) ([]interface{}, error) {
+	switch ref.field {
+	case "Payload.After":
+		return decodeDataValues(record.Payload.After, rawFormat)
+	case "Payload.Before":
+		return decodeDataValues(record.Payload.Before, rawFormat)
+	case "Key":
+		return decodeDataValues(record.Key, rawFormat)
+	case "Metadata":
+		v, ok := record.Metadata[ref.metaKey]
+		if !ok {
+			return nil, fmt.Errorf("metadata key %q not present", ref.metaKey)
+		}
+		return []interface{}{decodeMetadataValue(v)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported field reference %q", ref.field)
+	}
+}
+
+// decodeDataValues is like decodeData but additionally splits RawData into
+// multiple values when rawFormat calls for ND-JSON decoding.
+func decodeDataValues(d opencdc.Data, rawFormat string) ([]interface{}, error) {
+	switch v := d.(type) {
+	case opencdc.StructuredData:
+		return []interface{}{convertStructuredData(v)}, nil
+	case opencdc.RawData:
+		return decodeRawData(v, rawFormat)
+	case nil:
+		return nil, errors.New("no data present at field reference")
+	default:
+		return nil, fmt.Errorf("unsupported payload type: %T", d)
+	}
+}
+
+// decodeRawData decodes raw bytes as either a single JSON document ("json"),
+// newline-delimited JSON documents ("ndjson"), or by trying single-document
+// JSON first and falling back to ND-JSON ("auto").
+func decodeRawData(raw []byte, rawFormat string) ([]interface{}, error) {
+	if len(raw) == 0 {
+		return []interface{}{nil}, nil
+	}
+
+	switch rawFormat {
+	case rawFormatNDJSON:
+		return decodeNDJSON(raw)
+
+	case rawFormatAuto:
+		var single interface{}
+		if err := json.Unmarshal(raw, &single); err == nil {
+			return []interface{}{single}, nil
+		}
+		values, err := decodeNDJSON(raw)
+		if err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return values, nil
+
+	default: // rawFormatJSON
+		var single interface{}
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil, fmt.Errorf("invalid JSON payload: %w", err)
+		}
+		return []interface{}{single}, nil
+	}
+}
+
+// decodeNDJSON decodes newline-delimited JSON documents independently, line
+// by line: a malformed line is reported as an error value in its place in
+// values, rather than aborting the whole decode, so processRecord can apply
+// on_error to that single line without losing its well-formed siblings.
+func decodeNDJSON(raw []byte) ([]interface{}, error) {
+	values := make([]interface{}, 0, bytes.Count(raw, []byte("\n"))+1)
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(line, &v); err != nil {
+			values = append(values, fmt.Errorf("invalid ND-JSON line: %w", err))
+			continue
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// decodeMetadataValue best-effort JSON-decodes a metadata string value
+// (metadata is always string-valued in OpenCDC) so it can be queried like
+// any other JSON value; values that aren't valid JSON are passed through
+// as-is.
+func decodeMetadataValue(v string) interface{} {
+	var data interface{}
+	if err := json.Unmarshal([]byte(v), &data); err == nil {
+		return data
+	}
+	return v
+}
+
+// assignValue writes result to the location addressed by ref on record. If
+// ref has a subpath, result is set into the existing StructuredData at the
+// base field without disturbing sibling fields; otherwise the base field is
+// replaced wholesale, following the same type conventions as valueToPayload.
+func assignValue(record *opencdc.Record, ref fieldRef, result interface{}) error {
+	if len(ref.subpath) == 0 {
+		payload, err := valueToPayload(result)
+		if err != nil {
+			return err
+		}
+		return assignField(record, ref, payload)
+	}
+
+	base := fieldRef{field: ref.field, metaKey: ref.metaKey}
+	existing := map[string]interface{}{}
+	if current, err := extractValue(*record, base); err == nil {
+		if m, ok := current.(map[string]interface{}); ok {
+			existing = m
+		}
+	}
+
+	setNestedValue(existing, ref.subpath, result)
+	return assignField(record, base, opencdc.StructuredData(existing))
+}
+
+// setNestedValue sets value at the given "/"-separated path within m,
+// creating intermediate maps as needed.
+func setNestedValue(m map[string]interface{}, path []string, value interface{}) {
+	for i, seg := range path {
+		if i == len(path)-1 {
+			m[seg] = value
+			return
+		}
+		next, ok := m[seg].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[seg] = next
+		}
+		m = next
+	}
+}
+
+// assignField replaces the data held at ref's base field on record.
+func assignField(record *opencdc.Record, ref fieldRef, data opencdc.Data) error {
+	switch ref.field {
+	case "Payload.After":
+		record.Payload.After = data
+	case "Payload.Before":
+		record.Payload.Before = data
+	case "Key":
+		record.Key = data
+	case "Metadata":
+		// Clone before mutating: record.Metadata may be shared with other
+		// records via a shallow `recordCopy := record` in a fan-out path
+		// (multi_result "all", raw_format "ndjson"), and mutating it in
+		// place would make every emitted record alias the same map.
+		cloned := make(opencdc.Metadata, len(record.Metadata)+1)
+		for k, v := range record.Metadata {
+			cloned[k] = v
+		}
+		cloned[ref.metaKey] = metadataStringValue(data)
+		record.Metadata = cloned
+	default:
+		return fmt.Errorf("unsupported field reference %q", ref.field)
+	}
+	return nil
+}
+
+// metadataStringValue renders opencdc.Data as the string OpenCDC metadata
+// values require, JSON-encoding structured or raw-array/object data and
+// unquoting plain JSON scalars so they read naturally as metadata.
+func metadataStringValue(data opencdc.Data) string {
+	switch v := data.(type) {
+	case opencdc.RawData:
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			return s
+		}
+		return string(v)
+	case opencdc.StructuredData:
+		b, err := json.Marshal(map[string]interface{}(v))
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,90 @@
+package jsonquery
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestParseFieldRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		want    fieldRef
+		wantErr bool
+	}{
+		{
+			name: "payload after",
+			ref:  ".Payload.After",
+			want: fieldRef{field: "Payload.After"},
+		},
+		{
+			name: "payload after with subpath",
+			ref:  ".Payload.After/user/name",
+			want: fieldRef{field: "Payload.After", subpath: []string{"user", "name"}},
+		},
+		{
+			name: "key",
+			ref:  ".Key",
+			want: fieldRef{field: "Key"},
+		},
+		{
+			name: "metadata",
+			ref:  `.Metadata["tenant_id"]`,
+			want: fieldRef{field: "Metadata", metaKey: "tenant_id"},
+		},
+		{
+			name: "metadata with subpath",
+			ref:  `.Metadata["tenant_id"]/nested`,
+			want: fieldRef{field: "Metadata", metaKey: "tenant_id", subpath: []string{"nested"}},
+		},
+		{
+			name: "metadata key containing a slash",
+			ref:  `.Metadata["conduit.source/connector-id"]`,
+			want: fieldRef{field: "Metadata", metaKey: "conduit.source/connector-id"},
+		},
+		{
+			name: "metadata key containing a slash with subpath",
+			ref:  `.Metadata["conduit.source/connector-id"]/nested`,
+			want: fieldRef{field: "Metadata", metaKey: "conduit.source/connector-id", subpath: []string{"nested"}},
+		},
+		{
+			name:    "empty metadata key",
+			ref:     `.Metadata[""]`,
+			wantErr: true,
+		},
+		{
+			name:    "unterminated metadata reference",
+			ref:     `.Metadata["tenant_id"`,
+			wantErr: true,
+		},
+		{
+			name:    "metadata reference with garbage after the closing bracket",
+			ref:     `.Metadata["tenant_id"]garbage`,
+			wantErr: true,
+		},
+		{
+			name:    "missing leading dot",
+			ref:     "Payload.After",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported base",
+			ref:     ".Payload.Nonsense",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := parseFieldRef(tt.ref)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package jsonquery
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// Names of the built-in jq helpers the "functions" config option can enable.
+// jqFuncNow is deliberately not named "now": gojq already registers an
+// internal 0-arity "now" builtin and resolves it before any custom function
+// of the same name and arity, so a custom "now" would silently never run.
+const (
+	jqFuncNow  = "now_rfc3339"
+	jqFuncEnv  = "env"
+	jqFuncUUID = "uuid"
+)
+
+// parseJQVariables decodes a JSON object of jq variable bindings (e.g.
+// {"tenant": "acme", "cutoff": 100}) into the name/value slices gojq needs:
+// sorted, "$"-prefixed names for gojq.WithVariables at compile time, and
+// positional values in the same order for Code.Run at query time.
+func parseJQVariables(raw string) (names []string, values []interface{}, err error) {
+	if raw == "" {
+		return nil, nil, nil
+	}
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &vars); err != nil {
+		return nil, nil, fmt.Errorf("invalid variables: %w", err)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for name := range vars {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	names = make([]string, len(keys))
+	values = make([]interface{}, len(keys))
+	for i, key := range keys {
+		names[i] = "$" + key
+		values[i] = vars[key]
+	}
+	return names, values, nil
+}
+
+// parseJQFunctionOptions turns a comma-separated functions list (e.g.
+// "now_rfc3339,env,uuid") into gojq compiler options for the matching built-ins.
+func parseJQFunctionOptions(raw string) ([]gojq.CompilerOption, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var opts []gojq.CompilerOption
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case jqFuncNow:
+			opts = append(opts, gojq.WithFunction(jqFuncNow, 0, 0, jqNow))
+		case jqFuncEnv:
+			opts = append(opts, gojq.WithFunction(jqFuncEnv, 1, 1, jqEnv))
+		case jqFuncUUID:
+			opts = append(opts, gojq.WithFunction(jqFuncUUID, 0, 0, jqUUID))
+		default:
+			return nil, fmt.Errorf("unsupported jq function: %q", name)
+		}
+	}
+	return opts, nil
+}
+
+// jqNow implements the "now_rfc3339" jq builtin: the current UTC time as
+// RFC 3339.
+func jqNow(interface{}, []interface{}) interface{} {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// jqEnv implements the "env(name)" jq builtin: an environment variable
+// lookup, returning "" if it is unset.
+func jqEnv(_ interface{}, args []interface{}) interface{} {
+	name, ok := args[0].(string)
+	if !ok {
+		return fmt.Errorf("env/1: argument must be a string, got %T", args[0])
+	}
+	return os.Getenv(name)
+}
+
+// jqUUID implements the "uuid" jq builtin: a random (v4) UUID.
+func jqUUID(interface{}, []interface{}) interface{} {
+	return newUUIDv4()
+}
+
+// newUUIDv4 generates a random v4 UUID without requiring an external
+// dependency.
+func newUUIDv4() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
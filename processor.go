@@ -23,7 +23,15 @@ type Processor struct {
 
 	// Query engines
 	jmesCompiled *jmespath.JMESPath
-	jqCompiled   *gojq.Query
+	jqCode       *gojq.Code
+
+	// jqVarValues holds the jq variable bindings from ProcessorConfig.Variables,
+	// positional and in the same order as the names jqCode was compiled with.
+	jqVarValues []interface{}
+
+	// Parsed source/target field references
+	sourceRef fieldRef
+	targetRef fieldRef
 
 	sdk.UnimplementedProcessor
 }
@@ -35,14 +43,85 @@ type ProcessorConfig struct {
 
 	// Query contains the expression to evaluate against each JSON payload
 	Query string `json:"query" validate:"required"`
+
+	// Mode selects how the query result is used: "transform" (default)
+	// replaces the target field with the query result, "filter" treats the
+	// result as a boolean predicate and drops records for which it is falsy.
+	Mode string `json:"mode" validate:"omitempty,oneof=transform filter"`
+
+	// OnError controls what happens when processing a record fails (invalid
+	// JSON, a JMESPath/jq error, or a query that produces no results):
+	// "skip" (default) drops the record, "fail" returns an error record so
+	// Conduit's DLQ handling engages, "passthrough" emits the original
+	// record unchanged, and "nullify" emits the record with Payload.After
+	// set to an empty StructuredData.
+	OnError string `json:"on_error" validate:"omitempty,oneof=skip fail passthrough nullify"`
+
+	// MultiResult controls how queries that produce more than one value are
+	// handled: "first" keeps only the first result (default, preserves
+	// pre-existing behavior), "all" emits one record per result, and "array"
+	// wraps every result into a single StructuredData under MultiResultKey.
+	MultiResult string `json:"multi_result" validate:"omitempty,oneof=first all array"`
+
+	// MultiResultKey is the field name used to hold the collected results
+	// when MultiResult is "array".
+	MultiResultKey string `json:"multi_result_key"`
+
+	// Source is the field the query is evaluated against: ".Payload.After"
+	// (default), ".Payload.Before", ".Key", or `.Metadata["some.key"]`.
+	Source string `json:"source"`
+
+	// Target is the field the query result is written to. It defaults to
+	// Source, so a plain transform in place keeps working without either
+	// option set. Target may append a "/"-separated subpath (e.g.
+	// ".Payload.After/user/name") to assign the result into an existing
+	// StructuredData value without clobbering sibling fields.
+	Target string `json:"target"`
+
+	// RawFormat controls how RawData sources are parsed: "json" (default)
+	// parses the whole payload as a single JSON document, "ndjson" streams
+	// newline-delimited JSON documents and applies the query to each one,
+	// and "auto" tries a single document first and falls back to ND-JSON.
+	RawFormat string `json:"raw_format" validate:"omitempty,oneof=json ndjson auto"`
+
+	// Variables is a JSON object of jq variable bindings (e.g.
+	// {"tenant": "acme", "cutoff": 100}), made available in the query as
+	// $tenant, $cutoff, etc. Only used when Type is "jq".
+	Variables string `json:"variables"`
+
+	// Functions is a comma-separated list of built-in jq helpers to make
+	// available to the query: "now_rfc3339" (current UTC timestamp),
+	// "env" (env(name), environment variable lookup), and "uuid" (random UUID).
+	// Only used when Type is "jq".
+	Functions string `json:"functions"`
 }
 
+const (
+	multiResultFirst = "first"
+	multiResultAll   = "all"
+	multiResultArray = "array"
+
+	defaultMultiResultKey = "results"
+
+	modeTransform = "transform"
+	modeFilter    = "filter"
+
+	onErrorSkip        = "skip"
+	onErrorFail        = "fail"
+	onErrorPassthrough = "passthrough"
+	onErrorNullify     = "nullify"
+
+	rawFormatJSON   = "json"
+	rawFormatNDJSON = "ndjson"
+	rawFormatAuto   = "auto"
+)
+
 // Specification returns the processor specification.
 func Specification() sdk.Specification {
 	return sdk.Specification{
 		Name:        "json.query",
 		Summary:     "Query and transform JSON payloads using JMESPath or jq expressions",
-		Description: "This processor allows filtering and transformation of JSON messages using either JMESPath or jq syntax. It evaluates the specified query against each message's JSON payload and replaces the payload with the query result.",
+		Description: "This processor allows filtering and transformation of JSON messages using either JMESPath or jq syntax. It evaluates the specified query against a configurable source field (Payload.After by default) and, depending on mode, writes the result to a configurable target field or uses it as a keep/drop filter predicate, with a configurable policy for records that fail to process.",
 		Version:     "v0.1.0",
 		Author:      "Conduit Community",
 		Parameters: map[string]config.Parameter{
@@ -63,6 +142,63 @@ func Specification() sdk.Specification {
 					config.ValidationRequired{},
 				},
 			},
+			"mode": {
+				Description: "How the query result is used: 'transform' replaces the target field with the query result, 'filter' treats the result as a boolean predicate and drops records for which it is falsy",
+				Type:        config.ParameterTypeString,
+				Default:     modeTransform,
+				Validations: []config.Validation{
+					config.ValidationInclusion{List: []string{modeTransform, modeFilter}},
+				},
+			},
+			"on_error": {
+				Description: "What to do when processing a record fails: 'skip' drops the record, 'fail' returns an error record for Conduit's DLQ, 'passthrough' emits the original record unchanged, 'nullify' emits the record with Payload.After set to an empty StructuredData",
+				Type:        config.ParameterTypeString,
+				Default:     onErrorSkip,
+				Validations: []config.Validation{
+					config.ValidationInclusion{List: []string{onErrorSkip, onErrorFail, onErrorPassthrough, onErrorNullify}},
+				},
+			},
+			"multi_result": {
+				Description: "How to handle queries that produce more than one result: 'first' keeps only the first result, 'all' emits one record per result, 'array' collects every result into a single record under multi_result_key",
+				Type:        config.ParameterTypeString,
+				Default:     multiResultFirst,
+				Validations: []config.Validation{
+					config.ValidationInclusion{List: []string{multiResultFirst, multiResultAll, multiResultArray}},
+				},
+			},
+			"multi_result_key": {
+				Description: "Field name used to hold the collected results when multi_result is 'array'",
+				Type:        config.ParameterTypeString,
+				Default:     defaultMultiResultKey,
+			},
+			"source": {
+				Description: `Field the query is evaluated against, e.g. ".Payload.After", ".Payload.Before", ".Key", or .Metadata["some.key"]`,
+				Type:        config.ParameterTypeString,
+				Default:     defaultFieldRef,
+			},
+			"target": {
+				Description: `Field the query result is written to. Defaults to source. May append a "/"-separated subpath (e.g. ".Payload.After/user/name") to assign into an existing StructuredData value`,
+				Type:        config.ParameterTypeString,
+				Default:     "",
+			},
+			"raw_format": {
+				Description: "How to parse RawData sources: 'json' parses a single JSON document, 'ndjson' streams newline-delimited JSON documents into multiple records, 'auto' tries a single document first and falls back to ND-JSON",
+				Type:        config.ParameterTypeString,
+				Default:     rawFormatJSON,
+				Validations: []config.Validation{
+					config.ValidationInclusion{List: []string{rawFormatJSON, rawFormatNDJSON, rawFormatAuto}},
+				},
+			},
+			"variables": {
+				Description: `JSON object of jq variable bindings (e.g. {"tenant": "acme"}), exposed to the query as $tenant. Only used when type is "jq"`,
+				Type:        config.ParameterTypeString,
+				Default:     "",
+			},
+			"functions": {
+				Description: `Comma-separated list of built-in jq helpers to enable: "now_rfc3339", "env", "uuid". Only used when type is "jq"`,
+				Type:        config.ParameterTypeString,
+				Default:     "",
+			},
 		},
 	}
 }
@@ -82,6 +218,37 @@ func (p *Processor) Configure(ctx context.Context, cfg config.Config) error {
 		return fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if p.config.Mode == "" {
+		p.config.Mode = modeTransform
+	}
+	if p.config.OnError == "" {
+		p.config.OnError = onErrorSkip
+	}
+	if p.config.RawFormat == "" {
+		p.config.RawFormat = rawFormatJSON
+	}
+	if p.config.MultiResult == "" {
+		p.config.MultiResult = multiResultFirst
+	}
+	if p.config.MultiResultKey == "" {
+		p.config.MultiResultKey = defaultMultiResultKey
+	}
+	if p.config.Source == "" {
+		p.config.Source = defaultFieldRef
+	}
+	if p.config.Target == "" {
+		p.config.Target = p.config.Source
+	}
+
+	p.sourceRef, err = parseFieldRef(p.config.Source)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	p.targetRef, err = parseFieldRef(p.config.Target)
+	if err != nil {
+		return fmt.Errorf("invalid target: %w", err)
+	}
+
 	// Validate and compile query based on type
 	switch strings.ToLower(p.config.Type) {
 	case "jmespath":
@@ -96,7 +263,28 @@ func (p *Processor) Configure(ctx context.Context, cfg config.Config) error {
 		if err != nil {
 			return fmt.Errorf("invalid jq expression: %w", err)
 		}
-		p.jqCompiled = query
+
+		varNames, varValues, err := parseJQVariables(p.config.Variables)
+		if err != nil {
+			return err
+		}
+		funcOpts, err := parseJQFunctionOptions(p.config.Functions)
+		if err != nil {
+			return err
+		}
+
+		var opts []gojq.CompilerOption
+		if len(varNames) > 0 {
+			opts = append(opts, gojq.WithVariables(varNames))
+		}
+		opts = append(opts, funcOpts...)
+
+		code, err := gojq.Compile(query, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to compile jq expression: %w", err)
+		}
+		p.jqCode = code
+		p.jqVarValues = varValues
 		sdk.Logger(ctx).Info().Str("type", "jq").Str("query", p.config.Query).Msg("Compiled jq query")
 
 	default:
@@ -122,92 +310,255 @@ func (p *Processor) Process(ctx context.Context, records []opencdc.Record) []sdk
 		if err != nil {
 			logger.Error().Err(err).
 				Str("position", string(record.Position)).
+				Str("on_error", p.config.OnError).
 				Msg("Failed to process record")
-			// Skip records that fail processing
+			results = append(results, p.handleError(record, err)...)
 			continue
 		}
-		results = append(results, processed)
+		results = append(results, processed...)
 	}
 
 	return results
 }
 
-// processRecord processes a single record.
-func (p *Processor) processRecord(ctx context.Context, record opencdc.Record) (sdk.ProcessedRecord, error) {
-	// Extract payload data
-	var data interface{}
-
-	// Check if we have data in the After field (following OpenCDC convention)
-	if record.Payload.After != nil {
-		switch payload := record.Payload.After.(type) {
-		case opencdc.StructuredData:
-			// Convert StructuredData to a regular map for processing
-			data = convertStructuredData(payload)
-		case opencdc.RawData:
-			// Parse raw JSON data
-			if err := json.Unmarshal(payload, &data); err != nil {
-				return nil, fmt.Errorf("invalid JSON payload: %w", err)
+// handleError applies the configured on_error policy to a record whose
+// processing failed, returning zero or one processed records accordingly.
+func (p *Processor) handleError(record opencdc.Record, err error) []sdk.ProcessedRecord {
+	switch p.config.OnError {
+	case onErrorFail:
+		return []sdk.ProcessedRecord{sdk.ErrorRecord{Error: err}}
+	case onErrorPassthrough:
+		return []sdk.ProcessedRecord{sdk.SingleRecord(record)}
+	case onErrorNullify:
+		recordCopy := record
+		recordCopy.Payload.After = opencdc.StructuredData{}
+		return []sdk.ProcessedRecord{sdk.SingleRecord(recordCopy)}
+	default: // onErrorSkip
+		return nil
+	}
+}
+
+// processRecord processes a single record. Most records decode to a single
+// source value and produce one processed record (or several, in "all"
+// multi_result mode); a RawData source parsed as ND-JSON decodes to multiple
+// source values, one per line, each handled independently. When there are
+// multiple lines, a failure on one line does not discard the records already
+// built for its successful siblings: on_error is applied per line, and only a
+// single-line record's failure is propagated to the caller (so Process still
+// sees one error to log and apply on_error to for the non-ND-JSON case).
+func (p *Processor) processRecord(ctx context.Context, record opencdc.Record) ([]sdk.ProcessedRecord, error) {
+	sourceValues, err := extractValues(record, p.sourceRef, p.config.RawFormat)
+	if err != nil {
+		return nil, err
+	}
+	if len(sourceValues) == 0 {
+		return nil, errors.New("no data in source")
+	}
+
+	var out []sdk.ProcessedRecord
+	for lineIdx, data := range sourceValues {
+		recs, err := p.processLine(ctx, record, lineIdx, len(sourceValues), data)
+		if err != nil {
+			if len(sourceValues) > 1 {
+				out = append(out, p.handleError(p.lineRecord(record, lineIdx, len(sourceValues)), fmt.Errorf("line %d: %w", lineIdx, err))...)
+				continue
 			}
-		default:
-			return nil, fmt.Errorf("unsupported payload type: %T", payload)
+			return nil, err
+		}
+		out = append(out, recs...)
+	}
+
+	return out, nil
+}
+
+// processLine runs the query for a single source value (one ND-JSON line, or
+// the sole value for non-ND-JSON sources) and builds its processed records.
+// data is an error, rather than a decoded value, when decodeNDJSON couldn't
+// parse this particular line; that failure is handled the same as a query
+// failure so it doesn't abort the rest of the batch.
+func (p *Processor) processLine(ctx context.Context, record opencdc.Record, lineIdx, totalLines int, data interface{}) ([]sdk.ProcessedRecord, error) {
+	if lineErr, ok := data.(error); ok {
+		return nil, lineErr
+	}
+
+	queryResults, err := p.runQuery(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(queryResults) == 0 {
+		return nil, errors.New("query produced no results")
+	}
+
+	return p.buildRecords(ctx, record, lineIdx, totalLines, queryResults)
+}
+
+// lineRecord returns the copy of record that on_error handling should act on
+// for a given ND-JSON line, carrying the same derived position buildRecords
+// would have used had the line succeeded.
+func (p *Processor) lineRecord(record opencdc.Record, lineIdx, totalLines int) opencdc.Record {
+	if totalLines <= 1 {
+		return record
+	}
+	recordCopy := record
+	recordCopy.Position = derivePosition(record.Position, lineIdx)
+	return recordCopy
+}
+
+// buildRecords turns the results of one query evaluation into processed
+// records, honoring mode and multi_result. lineIdx/totalLines come from
+// ND-JSON line splitting; when totalLines is 1 the record's position is left
+// untouched, otherwise it gets a "#<lineIdx>" suffix.
+func (p *Processor) buildRecords(ctx context.Context, record opencdc.Record, lineIdx, totalLines int, queryResults []interface{}) ([]sdk.ProcessedRecord, error) {
+	basePos := record.Position
+	if totalLines > 1 {
+		basePos = derivePosition(record.Position, lineIdx)
+	}
+
+	if p.config.Mode == modeFilter {
+		p.logResult(ctx, record, queryResults[:1])
+		if !isTruthy(queryResults[0]) {
+			return []sdk.ProcessedRecord{sdk.FilterRecord{}}, nil
 		}
-	} else {
-		return nil, errors.New("no data in record.Payload.After")
+		// Keep the record as-is: filter mode is a predicate, not a rewrite.
+		recordCopy := record
+		recordCopy.Position = basePos
+		return []sdk.ProcessedRecord{sdk.SingleRecord(recordCopy)}, nil
 	}
 
-	// Apply query based on configured type
-	var result interface{}
-	var err error
+	switch p.config.MultiResult {
+	case multiResultAll:
+		out := make([]sdk.ProcessedRecord, 0, len(queryResults))
+		for i, result := range queryResults {
+			recordCopy := record
+			recordCopy.Position = derivePosition(basePos, i)
+			if err := assignValue(&recordCopy, p.targetRef, result); err != nil {
+				return nil, err
+			}
+			out = append(out, sdk.SingleRecord(recordCopy))
+		}
+		p.logResult(ctx, record, queryResults)
+		return out, nil
+
+	case multiResultArray:
+		recordCopy := record
+		recordCopy.Position = basePos
+		wrapped := map[string]interface{}{p.config.MultiResultKey: queryResults}
+		if err := assignValue(&recordCopy, p.targetRef, wrapped); err != nil {
+			return nil, err
+		}
+		p.logResult(ctx, record, queryResults)
+		return []sdk.ProcessedRecord{sdk.SingleRecord(recordCopy)}, nil
 
+	default: // multiResultFirst
+		recordCopy := record
+		recordCopy.Position = basePos
+		if err := assignValue(&recordCopy, p.targetRef, queryResults[0]); err != nil {
+			return nil, err
+		}
+		p.logResult(ctx, record, queryResults[:1])
+		return []sdk.ProcessedRecord{sdk.SingleRecord(recordCopy)}, nil
+	}
+}
+
+// runQuery evaluates the configured query against data and returns the
+// resulting values. For "first" mode only the first result is returned, even
+// if the underlying query would produce more.
+func (p *Processor) runQuery(data interface{}) ([]interface{}, error) {
 	switch strings.ToLower(p.config.Type) {
 	case "jmespath":
-		result, err = p.jmesCompiled.Search(data)
+		result, err := p.jmesCompiled.Search(data)
 		if err != nil {
 			return nil, fmt.Errorf("JMESPath query failed: %w", err)
 		}
+		// JMESPath always produces a single value. When multi_result asks for
+		// fan-out ("all" or "array") and that value happens to be a JSON
+		// array, honor the same knob by treating each array element as its
+		// own result.
+		if p.config.MultiResult == multiResultAll || p.config.MultiResult == multiResultArray {
+			if arr, ok := result.([]interface{}); ok {
+				return arr, nil
+			}
+		}
+		return []interface{}{result}, nil
 
 	case "jq":
-		iter := p.jqCompiled.Run(data)
-		// Get first result from jq iterator
-		val, ok := iter.Next()
-		if !ok {
-			return nil, errors.New("jq query produced no results")
-		}
-		if err, ok := val.(error); ok {
-			return nil, fmt.Errorf("jq query failed: %w", err)
+		iter := p.jqCode.Run(data, p.jqVarValues...)
+
+		var out []interface{}
+		for {
+			val, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := val.(error); ok {
+				return nil, fmt.Errorf("jq query failed: %w", err)
+			}
+			out = append(out, val)
+			if p.config.MultiResult == multiResultFirst {
+				break
+			}
 		}
-		result = val
+		return out, nil
 	}
 
-	// Create a copy of the record and update its payload
-	recordCopy := record
+	return nil, fmt.Errorf("unsupported query type: %s", p.config.Type)
+}
+
+// derivePosition appends an index suffix to pos, e.g. "<pos>#0", "<pos>#1", ...
+func derivePosition(pos opencdc.Position, index int) opencdc.Position {
+	return opencdc.Position(fmt.Sprintf("%s#%d", pos, index))
+}
 
-	// Set the result based on its type
+func (p *Processor) logResult(ctx context.Context, record opencdc.Record, results []interface{}) {
+	sdk.Logger(ctx).Debug().
+		Str("position", string(record.Position)).
+		Str("query_type", p.config.Type).
+		Str("multi_result", p.config.MultiResult).
+		Interface("results", results).
+		Msg("Successfully processed record")
+}
+
+// isTruthy applies jq/JMESPath truthiness to a query result for filter mode:
+// false, nil, and empty arrays/objects/strings are falsy; everything else,
+// including the number 0, is truthy.
+func isTruthy(result interface{}) bool {
+	switch v := result.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// valueToPayload converts a single query result into OpenCDC payload data,
+// following OpenCDC's convention of maps as StructuredData and everything
+// else as RawData.
+func valueToPayload(result interface{}) (opencdc.Data, error) {
 	switch v := result.(type) {
 	case map[string]interface{}:
 		// Maps are stored as StructuredData
-		recordCopy.Payload.After = opencdc.StructuredData(v)
+		return opencdc.StructuredData(v), nil
 	case []interface{}:
 		// Arrays need to be wrapped in a map for StructuredData
-		recordCopy.Payload.After = opencdc.StructuredData(map[string]interface{}{
+		return opencdc.StructuredData(map[string]interface{}{
 			"result": v,
-		})
+		}), nil
 	default:
 		// For scalar values (string, number, bool, nil), convert to JSON and store as RawData
 		jsonBytes, err := json.Marshal(result)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal result: %w", err)
 		}
-		recordCopy.Payload.After = opencdc.RawData(jsonBytes)
+		return opencdc.RawData(jsonBytes), nil
 	}
-
-	sdk.Logger(ctx).Debug().
-		Str("position", string(record.Position)).
-		Str("query_type", p.config.Type).
-		Interface("result", result).
-		Msg("Successfully processed record")
-
-	return sdk.SingleRecord(recordCopy), nil
 }
 
 // convertStructuredData recursively converts opencdc.StructuredData to regular maps/slices
@@ -2,6 +2,7 @@ package jsonquery
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/conduitio/conduit-commons/config"
@@ -66,6 +67,42 @@ func TestProcessor_Configure(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid jq config with variables",
+			config: config.Config{
+				"type":      "jq",
+				"query":     "$tenant",
+				"variables": `{"tenant": "acme"}`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid jq variables",
+			config: config.Config{
+				"type":      "jq",
+				"query":     ".name",
+				"variables": `not json`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid jq config with functions",
+			config: config.Config{
+				"type":      "jq",
+				"query":     "uuid",
+				"functions": "uuid",
+			},
+			wantErr: false,
+		},
+		{
+			name: "unsupported jq function",
+			config: config.Config{
+				"type":      "jq",
+				"query":     ".name",
+				"functions": "not-a-function",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -196,6 +233,465 @@ func TestProcessor_Process_InvalidJSON(t *testing.T) {
 	is.Equal(len(results), 0) // Record should be skipped
 }
 
+func TestProcessor_Process_MultiResultAll_JQ(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":         "jq",
+		"query":        ".items[]",
+		"multi_result": "all",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	input := opencdc.StructuredData{
+		"items": []interface{}{"a", "b", "c"},
+	}
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-6"),
+		Payload:  opencdc.Change{After: input},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 3)
+
+	for i, want := range []string{`"a"`, `"b"`, `"c"`} {
+		processed := results[i].(sdk.SingleRecord)
+		is.Equal(processed.Position, opencdc.Position(fmt.Sprintf("test-pos-6#%d", i)))
+		is.Equal(string(processed.Payload.After.(opencdc.RawData)), want)
+	}
+}
+
+func TestProcessor_Process_MultiResultArray_JQ(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":             "jq",
+		"query":            ".items[]",
+		"multi_result":     "array",
+		"multi_result_key": "items_out",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	input := opencdc.StructuredData{
+		"items": []interface{}{"a", "b", "c"},
+	}
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-7"),
+		Payload:  opencdc.Change{After: input},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	result := processed.Payload.After.(opencdc.StructuredData)
+	is.Equal(result["items_out"], []interface{}{"a", "b", "c"})
+}
+
+func TestProcessor_Process_MultiResultArray_JMESPath(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":             "jmespath",
+		"query":            "items",
+		"multi_result":     "array",
+		"multi_result_key": "items_out",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	input := opencdc.StructuredData{
+		"items": []interface{}{"a", "b", "c"},
+	}
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-7b"),
+		Payload:  opencdc.Change{After: input},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	result := processed.Payload.After.(opencdc.StructuredData)
+	is.Equal(result["items_out"], []interface{}{"a", "b", "c"})
+}
+
+func TestProcessor_Process_SourceKey_TargetMetadata(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":   "jq",
+		"query":  ".tenant",
+		"source": ".Key",
+		"target": `.Metadata["tenant_id"]`,
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-8"),
+		Key:      opencdc.RawData(`{"tenant": "acme"}`),
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"untouched": true}},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	is.Equal(processed.Metadata["tenant_id"], "acme")
+	// Payload.After is left alone since target only touches metadata.
+	is.Equal(processed.Payload.After.(opencdc.StructuredData)["untouched"], true)
+}
+
+func TestProcessor_Process_TargetSubpath(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":   "jq",
+		"query":  ".user.name | ascii_upcase",
+		"source": ".Payload.Before",
+		"target": ".Payload.After/user/name_upper",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-9"),
+		Payload: opencdc.Change{
+			Before: opencdc.StructuredData{
+				"user": map[string]interface{}{"name": "alice"},
+			},
+			After: opencdc.StructuredData{
+				"user": map[string]interface{}{"name": "alice", "id": 1},
+			},
+		},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	after := processed.Payload.After.(opencdc.StructuredData)
+	user := after["user"].(map[string]interface{})
+	is.Equal(user["name"], "alice")
+	is.Equal(user["id"], 1)
+	is.Equal(user["name_upper"], "ALICE")
+}
+
+func TestProcessor_Process_FilterMode(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":  "jq",
+		"query": `.event_type == "purchase"`,
+		"mode":  "filter",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	keep := opencdc.Record{
+		Position: []byte("test-pos-10"),
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"event_type": "purchase"}},
+	}
+	drop := opencdc.Record{
+		Position: []byte("test-pos-11"),
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"event_type": "view"}},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{keep, drop})
+	is.Equal(len(results), 2)
+
+	kept := results[0].(sdk.SingleRecord)
+	is.Equal(kept.Payload.After.(opencdc.StructuredData)["event_type"], "purchase")
+
+	_, dropped := results[1].(sdk.FilterRecord)
+	is.True(dropped)
+}
+
+func TestProcessor_Process_JQVariables(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":      "jq",
+		"query":     `.name + "-" + $suffix`,
+		"variables": `{"suffix": "acme"}`,
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-20"),
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"name": "order"}},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	single := results[0].(sdk.SingleRecord)
+	is.Equal(single.Payload.After.(opencdc.RawData).Bytes(), []byte(`"order-acme"`))
+}
+
+func TestProcessor_Process_JQFunctions(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	t.Setenv("JSONQUERY_TEST_VAR", "hello")
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":      "jq",
+		"query":     `env("JSONQUERY_TEST_VAR")`,
+		"functions": "env",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-21"),
+		Payload:  opencdc.Change{After: opencdc.StructuredData{"name": "order"}},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	single := results[0].(sdk.SingleRecord)
+	is.Equal(single.Payload.After.(opencdc.RawData).Bytes(), []byte(`"hello"`))
+}
+
+func TestProcessor_Process_OnErrorSkip(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":     "jmespath",
+		"query":    "test",
+		"on_error": "skip",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-12"),
+		Payload:  opencdc.Change{After: opencdc.RawData([]byte("invalid json"))},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 0)
+}
+
+func TestProcessor_Process_OnErrorFail(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":     "jmespath",
+		"query":    "test",
+		"on_error": "fail",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-13"),
+		Payload:  opencdc.Change{After: opencdc.RawData([]byte("invalid json"))},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	errRecord, ok := results[0].(sdk.ErrorRecord)
+	is.True(ok)
+	is.True(errRecord.Error != nil)
+}
+
+func TestProcessor_Process_OnErrorPassthrough(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":     "jmespath",
+		"query":    "test",
+		"on_error": "passthrough",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-14"),
+		Payload:  opencdc.Change{After: opencdc.RawData([]byte("invalid json"))},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	is.Equal(string(processed.Payload.After.(opencdc.RawData)), "invalid json")
+}
+
+func TestProcessor_Process_OnErrorNullify(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":     "jmespath",
+		"query":    "test",
+		"on_error": "nullify",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-15"),
+		Payload:  opencdc.Change{After: opencdc.RawData([]byte("invalid json"))},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	is.Equal(processed.Payload.After.(opencdc.StructuredData), opencdc.StructuredData{})
+}
+
+func TestProcessor_Process_NDJSON(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":       "jmespath",
+		"query":      "name",
+		"raw_format": "ndjson",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	ndjson := []byte("{\"name\": \"a\"}\n{\"name\": \"b\"}\n{\"name\": \"c\"}\n")
+	record := opencdc.Record{
+		Position: []byte("test-pos-16"),
+		Payload:  opencdc.Change{After: opencdc.RawData(ndjson)},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 3)
+
+	for i, want := range []string{`"a"`, `"b"`, `"c"`} {
+		processed := results[i].(sdk.SingleRecord)
+		is.Equal(processed.Position, opencdc.Position(fmt.Sprintf("test-pos-16#%d", i)))
+		is.Equal(string(processed.Payload.After.(opencdc.RawData)), want)
+	}
+}
+
+func TestProcessor_Process_NDJSON_OnErrorSkipPerLine(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":       "jq",
+		"query":      ".n / .d",
+		"raw_format": "ndjson",
+		"on_error":   "skip",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	ndjson := []byte(
+		"{\"n\": 4, \"d\": 2}\n" +
+			"{\"n\": 1, \"d\": 0}\n" +
+			"{\"n\": 9, \"d\": 3}\n",
+	)
+	record := opencdc.Record{
+		Position: []byte("test-pos-17"),
+		Payload:  opencdc.Change{After: opencdc.RawData(ndjson)},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 2)
+
+	for i, want := range []string{"2", "3"} {
+		processed := results[i].(sdk.SingleRecord)
+		is.Equal(string(processed.Payload.After.(opencdc.RawData)), want)
+	}
+}
+
+func TestProcessor_Process_NDJSON_MalformedLineSkipPerLine(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":       "jmespath",
+		"query":      "name",
+		"raw_format": "ndjson",
+		"on_error":   "skip",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	ndjson := []byte("{\"name\": \"a\"}\nnot-json-at-all\n{\"name\": \"c\"}\n")
+	record := opencdc.Record{
+		Position: []byte("test-pos-18"),
+		Payload:  opencdc.Change{After: opencdc.RawData(ndjson)},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 2)
+
+	for i, want := range []string{`"a"`, `"c"`} {
+		processed := results[i].(sdk.SingleRecord)
+		is.Equal(string(processed.Payload.After.(opencdc.RawData)), want)
+	}
+}
+
+func TestProcessor_Process_RawFormatAuto_SingleDocument(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	p := NewProcessor()
+	err := p.Configure(ctx, config.Config{
+		"type":       "jmespath",
+		"query":      "status",
+		"raw_format": "auto",
+	})
+	is.NoErr(err)
+	is.NoErr(p.Open(ctx))
+
+	record := opencdc.Record{
+		Position: []byte("test-pos-17"),
+		Payload:  opencdc.Change{After: opencdc.RawData([]byte(`{"status": "ok"}`))},
+	}
+
+	results := p.Process(ctx, []opencdc.Record{record})
+	is.Equal(len(results), 1)
+
+	processed := results[0].(sdk.SingleRecord)
+	is.Equal(processed.Position, opencdc.Position("test-pos-17"))
+	is.Equal(string(processed.Payload.After.(opencdc.RawData)), `"ok"`)
+}
+
 func TestProcessor_Process_ComplexJQ(t *testing.T) {
 	is := is.New(t)
 	ctx := context.Background()